@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Lease is an opaque handle returned by Broker.Claim that must be passed back
+// to Renew, Ack, or Nack. Its concrete type is defined by the broker that
+// issued it; callers should never need to inspect it.
+type Lease interface{}
+
+// ErrItemLocked is returned by Claim when a work item exists but is currently
+// held by another consumer. The caller should move on and try the next item
+// rather than treat this as a hard error.
+var ErrItemLocked = errors.New("work item is locked by another consumer")
+
+// ErrNoItemAvailable is returned by Claim when there is currently nothing to
+// claim.
+var ErrNoItemAvailable = errors.New("no work item available")
+
+// Broker abstracts the queue/stream backend that supplies work items. w8y
+// ships drivers for Redis lists, Kafka consumer groups, NATS JetStream pull
+// consumers, and AWS SQS; see redis_broker.go, kafka_broker.go, nats_broker.go,
+// and sqs_broker.go.
+type Broker interface {
+	// Claim retrieves the next work item and a lease representing ownership
+	// of it. Returns ErrItemLocked if an item exists but another consumer
+	// currently holds it, or ErrNoItemAvailable if there is nothing to do.
+	Claim(ctx context.Context) (item string, lease Lease, err error)
+
+	// Renew extends ownership of lease. Called periodically while the child
+	// process for a claimed item is still running.
+	Renew(ctx context.Context, lease Lease) error
+
+	// Ack marks lease as successfully processed.
+	Ack(ctx context.Context, lease Lease) error
+
+	// Nack marks lease as failed to process. cause is the error (if any)
+	// that caused the failure, for brokers that record it.
+	Nack(ctx context.Context, lease Lease, cause error) error
+
+	// Close releases any resources held by the broker.
+	Close() error
+}
+
+// NackInfo is an optional, richer cause passed to Nack for a child process
+// that ran and exited with a code outside --exit-codes, for brokers that
+// record failure diagnostics (e.g. the Redis list broker's dead-letter
+// metadata, in redis_broker.go). Brokers that don't care about diagnostics
+// can keep treating cause as a plain error, since NackInfo implements one.
+type NackInfo struct {
+	ExitCode   int
+	StderrTail string
+	Err        error
+}
+
+func (n *NackInfo) Error() string {
+	if n.Err != nil {
+		return fmt.Sprintf("child exited %d: %v", n.ExitCode, n.Err)
+	}
+	return fmt.Sprintf("child exited %d", n.ExitCode)
+}
+
+func (n *NackInfo) Unwrap() error { return n.Err }
+
+// Lengthable is optionally implemented by brokers that can report how many
+// work items are currently outstanding. main uses it to bound non-continuous
+// mode to a single pass over the backlog, the same way it always has for the
+// Redis list broker.
+type Lengthable interface {
+	Len(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// jsonSchema is the compiled --jsonschema document, loaded once by
+// loadJSONSchema; nil means no schema was given and every item passes.
+var jsonSchema *gojsonschema.Schema
+
+// loadJSONSchema compiles the schema at path and caches it in jsonSchema for
+// every item validated for the remainder of this process.
+func loadJSONSchema(path string) {
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + path))
+	if err != nil {
+		log.Printf("error loading --jsonschema %#v: %v\n", path, err)
+		os.Exit(2)
+	}
+	jsonSchema = schema
+}
+
+// decodeWorkItem parses raw according to opts.ItemFormat. In the default
+// "raw" format the work item is just the string itself; in "json" format it
+// is unmarshalled so template expansion and --jsonschema validation can
+// address its fields.
+func decodeWorkItem(opts *Options, raw string) (data interface{}, err error) {
+	if opts.ItemFormat != "json" {
+		return raw, nil
+	}
+
+	if err = json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, fmt.Errorf("invalid JSON work item: %w", err)
+	}
+	return data, nil
+}
+
+// validateWorkItem reports whether data passes --jsonschema, logging the
+// validation errors if not. It always passes when no schema was given.
+func validateWorkItem(data interface{}) (valid bool, err error) {
+	if jsonSchema == nil {
+		return true, nil
+	}
+
+	var result *gojsonschema.Result
+	if result, err = jsonSchema.Validate(gojsonschema.NewGoLoader(data)); err != nil {
+		return false, err
+	}
+	if !result.Valid() {
+		for _, resultErr := range result.Errors() {
+			log.Printf("work item failed jsonschema validation: %s\n", resultErr)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// renderTemplate parses text as a Go text/template and executes it with data
+// as the root context, so templates can refer to it as "{{.}}" or, for a
+// parsed JSON object, "{{.Field}}".
+func renderTemplate(name string, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// loadTemplateSource returns the literal text of spec, or the contents of a
+// file if spec begins with '@' (e.g. --stdin-template=@job.tmpl).
+func loadTemplateSource(spec string) (string, error) {
+	if !strings.HasPrefix(spec, "@") {
+		return spec, nil
+	}
+
+	contents, err := os.ReadFile(spec[1:])
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeWorkItem(t *testing.T) {
+	tests := []struct {
+		name       string
+		itemFormat string
+		raw        string
+		want       interface{}
+		wantErr    bool
+	}{
+		{"raw format returns string as-is", "raw", "hello world", "hello world", false},
+		{"default format returns string as-is", "", `{"a":1}`, `{"a":1}`, false},
+		{"json format parses object", "json", `{"a":1,"b":"two"}`, map[string]interface{}{"a": 1.0, "b": "two"}, false},
+		{"json format parses array", "json", `[1,2,3]`, []interface{}{1.0, 2.0, 3.0}, false},
+		{"json format rejects invalid JSON", "json", `not json`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{ItemFormat: tt.itemFormat}
+			got, err := decodeWorkItem(opts, tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeWorkItem(%#v) = nil error, want error", tt.raw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeWorkItem(%#v) unexpected error: %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeWorkItem(%#v) = %#v, want %#v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		data    interface{}
+		want    string
+		wantErr bool
+	}{
+		{"literal string data", "item={{.}}", "abc123", "item=abc123", false},
+		{"field access on map data", "id={{.id}}", map[string]interface{}{"id": "42"}, "id=42", false},
+		{"invalid template syntax", "{{.Unterminated", nil, "", true},
+		{"execution error on missing method", "{{.Missing.Field}}", "a string", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplate("test", tt.text, tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("renderTemplate(%#v) = nil error, want error", tt.text)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderTemplate(%#v) unexpected error: %v", tt.text, err)
+			}
+			if got != tt.want {
+				t.Errorf("renderTemplate(%#v) = %#v, want %#v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplateSource(t *testing.T) {
+	dir := t.TempDir()
+	tmplPath := filepath.Join(dir, "job.tmpl")
+	if err := os.WriteFile(tmplPath, []byte("hello {{.}}"), 0o600); err != nil {
+		t.Fatalf("writing test template file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"literal spec returned as-is", "literal template text", "literal template text", false},
+		{"@ prefix reads file contents", "@" + tmplPath, "hello {{.}}", false},
+		{"@ prefix missing file errors", "@" + filepath.Join(dir, "missing.tmpl"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadTemplateSource(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("loadTemplateSource(%#v) = nil error, want error", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadTemplateSource(%#v) unexpected error: %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("loadTemplateSource(%#v) = %#v, want %#v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
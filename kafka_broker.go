@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// kafkaBroker implements Broker on top of a Kafka consumer group. Ownership
+// of a partition (and therefore of the messages read from it) is arbitrated
+// by the Kafka group coordinator, so unlike redisBroker there is no separate
+// lock key: Claim never returns ErrItemLocked. Renew is a no-op since group
+// membership is kept alive by the consumer's background heartbeats; Ack
+// commits the message's offset, and Nack deliberately does not, so the
+// message is re-delivered to the group after a rebalance.
+type kafkaBroker struct {
+	reader *kafka.Reader
+}
+
+// kafkaLease carries the message whose offset Ack will commit.
+type kafkaLease struct {
+	msg kafka.Message
+}
+
+func newKafkaBroker(brokerUrl string, topic string, group string) *kafkaBroker {
+	return &kafkaBroker{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: strings.Split(brokerUrl, ","),
+			Topic:   topic,
+			GroupID: group,
+		}),
+	}
+}
+
+func (b *kafkaBroker) Claim(ctx context.Context) (item string, lease Lease, err error) {
+	var msg kafka.Message
+	if msg, err = b.reader.FetchMessage(ctx); err != nil {
+		if err == context.DeadlineExceeded || err == context.Canceled {
+			err = ErrNoItemAvailable
+		}
+		return
+	}
+
+	item = string(msg.Value)
+	lease = &kafkaLease{msg: msg}
+	return
+}
+
+// Renew is a no-op: the kafka-go reader's background goroutines already send
+// heartbeats on the process's behalf for as long as it's running.
+func (b *kafkaBroker) Renew(ctx context.Context, lease Lease) error {
+	return nil
+}
+
+func (b *kafkaBroker) Ack(ctx context.Context, lease Lease) error {
+	kl := lease.(*kafkaLease)
+	return b.reader.CommitMessages(ctx, kl.msg)
+}
+
+// Nack deliberately does not commit the message's offset, so it will be
+// redelivered to the consumer group (to this or another member) once the
+// broker's offset retention allows it.
+func (b *kafkaBroker) Nack(ctx context.Context, lease Lease, cause error) error {
+	return nil
+}
+
+func (b *kafkaBroker) Close() error {
+	return b.reader.Close()
+}
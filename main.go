@@ -2,30 +2,60 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
-	"github.com/go-redis/redis/v8"
 	"github.com/jessevdk/go-flags"
 	"io"
 	logger "log"
 	"os"
 	"os/exec"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 type Options struct {
-	RedisUrl  string `short:"u" long:"redis-url" default:"redis://localhost:6379" description:"Redis URL to connect to"`
-	KeyPrefix string `short:"k" long:"key-prefix" description:"Redis prefix for all keys"`
-	KeyExpiry int    `short:"x" long:"key-expiry" default:"5" description:"Redis lock key expiry in seconds"`
-	EnvVar    string `short:"e" long:"env-var" description:"Environment variable name to set work item to"`
+	Broker    string `short:"b" long:"broker" default:"redis" description:"Broker backend to use: redis, kafka, nats, or sqs"`
+	BrokerUrl string `long:"broker-url" description:"Broker connection string; comma-separated host:port list for kafka, server URL for nats, queue URL for sqs"`
+	Group     string `short:"g" long:"group" description:"Consumer group name (kafka group id, nats durable name, redis stream group in --mode=stream; unused otherwise)"`
+	Topic     string `long:"topic" description:"Kafka topic or NATS subject to consume from (unused for redis and sqs)"`
+
+	RedisUrl      string `short:"u" long:"redis-url" default:"redis://localhost:6379" description:"Redis URL to connect to (used when --broker=redis); also accepts redis+sentinel:// and redis+cluster:// schemes"`
+	KeyPrefix     string `short:"k" long:"key-prefix" description:"Redis prefix for all keys (used when --broker=redis)"`
+	KeyExpiry     int    `short:"x" long:"key-expiry" default:"5" description:"Redis lock key / SQS visibility timeout in seconds"`
+	EnvVar        string `short:"e" long:"env-var" description:"Environment variable name to set work item to"`
+	RedisTLS      bool   `long:"redis-tls" description:"Enable TLS when connecting to Redis"`
+	RedisUsername string `long:"redis-username" description:"Redis ACL username (overrides any username in --redis-url)"`
+	RedisCA       string `long:"redis-ca" description:"Path to a PEM CA certificate to verify the Redis server with"`
+	RedisCert     string `long:"redis-cert" description:"Path to a PEM client certificate for Redis mutual TLS"`
+	RedisKey      string `long:"redis-key" description:"Path to the PEM private key matching --redis-cert"`
+
+	ItemFormat    string   `long:"item-format" default:"raw" description:"Work item format: raw (literal string) or json (parsed so {{.Field}} templates can reference it)"`
+	Env           []string `long:"env" description:"Additional NAME=template environment variable to set for the child, rendered as a Go template with the work item as {{.}}; may be given multiple times"`
+	StdinTemplate string   `long:"stdin-template" description:"Go template (or @path to a template file) to render and pipe into the child's stdin, with the work item as {{.}}"`
+	JSONSchema    string   `long:"jsonschema" description:"Path to a JSON schema file; JSON work items failing validation are skipped and logged rather than dispatched"`
+
+	Mode        string `long:"mode" default:"list" description:"Redis consumption mode: list (LMOVE+SETNX) or stream (XREADGROUP+XCLAIM), used when --broker=redis"`
+	Consumer    string `long:"consumer" description:"Consumer name to join --group as, in stream mode (default: hostname-pid)"`
+	StreamField string `long:"stream-field" default:"payload" description:"Stream entry field to read the work item value from, in stream mode"`
+	MinIdleTime int    `long:"min-idle-time" default:"30" description:"Minimum idle time in seconds before a pending stream entry is reclaimed from a dead consumer"`
+
+	MaxAttempts   int    `long:"max-attempts" default:"0" description:"Maximum delivery attempts for a failing item before it is moved to --dead-letter-key (0 disables retry tracking; used when --broker=redis --mode=list)"`
+	Backoff       string `long:"backoff" default:"exponential:1s:60s" description:"Retry backoff policy for --max-attempts, as kind:base:max (only exponential is supported)"`
+	DeadLetterKey string `long:"dead-letter-key" description:"Redis list key to push failed items and their failure metadata to once --max-attempts is exceeded (default: <key-prefix>dead)"`
 
 	Continuous          bool  `short:"c" long:"continuous" description:"Run continuously"`
 	ContinueOnExitCodes []int `short:"i" long:"exit-codes" default:"0" description:"Continue on any of these exit codes returned"`
+	Parallel            int   `short:"p" long:"parallel" default:"1" description:"Number of work items to claim and run concurrently within this process"`
 
 	Quiet           bool   `short:"q" long:"quiet" description:"Silence output of w8y to capture pure stdout,stderr of spawned executable"`
 	LogFile         string `short:"f" long:"log-file" description:"Log to file"`
 	NoLogTimestamps bool   `short:"t" long:"no-log-timestamps" description:"Disable inclusion of timestamps in log lines"`
+	LogFormat       string `long:"log-format" default:"text" description:"Format for per-item lifecycle log lines: text or json (item, lock_key, attempt, duration_ms, exit_code)"`
+
+	MetricsAddr string `long:"metrics-addr" description:"Address (e.g. :9090) to serve Prometheus metrics on at /metrics; unset disables metrics"`
 
 	Args struct {
 		Executable string   `positional-arg-name:"executable"`
@@ -56,31 +86,66 @@ func main() {
 
 	validateOptions(opts)
 
-	rds := connectRedis(opts.RedisUrl)
+	if opts.MetricsAddr != "" {
+		startMetricsServer(opts.MetricsAddr)
+	}
+
+	broker := connectBroker(opts)
 	defer func() {
-		err = rds.Close()
-		if err != nil {
-			log.Printf("error closing redis connection: %v\n", err)
+		if err = broker.Close(); err != nil {
+			log.Printf("error closing broker: %v\n", err)
 			os.Exit(2)
 		}
 	}()
 
-	ctx := context.Background()
-
-	listKey := opts.KeyPrefix + "list"
-	lockKeyPrefix := opts.KeyPrefix + "lock:"
-	log.Printf("list key = %#v\n", listKey)
+	// claimCtx governs only calls to Broker.Claim: cancelling it tells workers to stop picking up new
+	// items. workCtx governs lease renewal and Ack/Nack for items already claimed, and is never cancelled
+	// by a signal, so an in-flight child process is always allowed to finish and its lease resolved
+	// cleanly. This is what makes SIGTERM a graceful drain rather than an abrupt stop.
+	claimCtx, cancelClaim := context.WithCancel(context.Background())
+	workCtx := context.Background()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigCh
+		log.Printf("received %v; draining in-flight work items before exit\n", sig)
+		cancelClaim()
+	}()
 
 	var exitCode int
+	if opts.Parallel <= 1 {
+		exitCode = runWorker(claimCtx, workCtx, broker, opts)
+	} else {
+		exitCode = runWorkerPool(claimCtx, workCtx, broker, opts)
+	}
+
+	os.Exit(exitCode)
+}
+
+// runWorker runs a single worker loop to completion: continuously, through a
+// single bounded pass over the broker's outstanding items, or once, depending
+// on opts and what the broker supports. claimCtx is used only for Claim, so
+// that cancelling it stops new work being picked up without disturbing any
+// item already in flight.
+func runWorker(claimCtx context.Context, workCtx context.Context, broker Broker, opts *Options) (exitCode int) {
+	var err error
 
 	if opts.Continuous {
 	loop:
-		for {
-			var shouldContinue bool
-			shouldContinue, exitCode, err = iterateList(ctx, rds, listKey, lockKeyPrefix, opts)
+		for claimCtx.Err() == nil {
+			var shouldContinue, claimed bool
+			var code int
+			shouldContinue, claimed, code, err = iterateBroker(claimCtx, workCtx, broker, opts)
 			if shouldContinue {
 				continue
 			}
+			if !claimed {
+				// nothing was available to claim (empty queue, or a graceful
+				// shutdown): there is no exit code to report.
+				break
+			}
+			exitCode = code
 
 			if err != nil {
 				break
@@ -96,26 +161,30 @@ func main() {
 			log.Printf("exit code %d not in continue list\n", exitCode)
 			break
 		}
-	} else {
-		// check list length up front so we don't end up circling around the list forever. the list length may change during
-		// iteration but this is okay since we can always restart and pick up the new list size.
-		var listLen int64
-		log.Printf("checking length of %#v\n", listKey)
-		if listLen, err = rds.LLen(ctx, listKey).Result(); err != nil {
+	} else if lengthable, ok := broker.(Lengthable); ok {
+		// check outstanding item count up front so we don't end up circling around forever. this count may change
+		// during iteration but this is okay since we can always restart and pick up the new count.
+		var itemCount int64
+		log.Println("checking outstanding item count")
+		if itemCount, err = lengthable.Len(workCtx); err != nil {
 			log.Println(err)
 			os.Exit(2)
 		}
-		log.Printf("length of %#v is %v\n", listKey, listLen)
-		if listLen <= 0 {
+		log.Printf("outstanding item count is %v\n", itemCount)
+		if itemCount <= 0 {
 			log.Println("empty; no work to do")
-			os.Exit(0)
+			return 0
 		}
 
-		// iterate once through the list of items:
-		for i := int64(0); i < listLen; i++ {
-			var shouldContinue bool
+		// iterate once through the outstanding items:
+		for i := int64(0); i < itemCount && claimCtx.Err() == nil; i++ {
+			var shouldContinue, claimed bool
+			var code int
 
-			shouldContinue, exitCode, err = iterateList(ctx, rds, listKey, lockKeyPrefix, opts)
+			shouldContinue, claimed, code, err = iterateBroker(claimCtx, workCtx, broker, opts)
+			if claimed {
+				exitCode = code
+			}
 
 			if err != nil {
 				break
@@ -124,65 +193,196 @@ func main() {
 				break
 			}
 		}
+	} else {
+		// broker can't report an outstanding count (e.g. kafka, nats, sqs); claim and process a single item.
+		exitCode, err = runOnce(claimCtx, workCtx, broker, opts)
 	}
 
-	os.Exit(exitCode)
+	return exitCode
 }
 
-func iterateList(ctx context.Context, rds *redis.Client, listKey string, lockKeyPrefix string, opts *Options) (shouldContinue bool, exitCode int, err error) {
-	shouldContinue = false
-	exitCode = -1
+// runWorkerPool runs opts.Parallel independent runWorker loops concurrently
+// against the same broker, each claiming and processing distinct work items.
+// Backpressure falls out naturally: a worker only claims its next item once
+// it has finished the previous one, so at most opts.Parallel items are ever
+// in flight. The aggregate exit code is non-zero if any worker's last exit
+// code fell outside --exit-codes.
+func runWorkerPool(claimCtx context.Context, workCtx context.Context, broker Broker, opts *Options) int {
+	log.Printf("starting %d parallel workers\n", opts.Parallel)
+
+	var wg sync.WaitGroup
+	exitCodes := make([]int, opts.Parallel)
+	for i := 0; i < opts.Parallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			exitCodes[i] = runWorker(claimCtx, workCtx, broker, opts)
+		}(i)
+	}
+	wg.Wait()
 
-	// pop from left side of list and atomically append to right side of list:
-	var workItem string
-	if workItem, err = rds.LMove(ctx, listKey, listKey, "left", "right").Result(); err != nil {
-		log.Printf("LMOVE error: %v\n", err)
-		return
+	for _, exitCode := range exitCodes {
+		accepted := false
+		for _, okExitCode := range opts.ContinueOnExitCodes {
+			if okExitCode == exitCode {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			log.Printf("at least one worker's exit code %d was not in the continue list\n", exitCode)
+			return 1
+		}
 	}
+	return 0
+}
 
-	// attempt to take the lock:
-	lockKey := lockKeyPrefix + workItem
+// connectBroker builds the Broker selected by opts.Broker, exiting the
+// process if the selection or its connection parameters are invalid.
+func connectBroker(opts *Options) Broker {
 	keyExpiry := time.Second * time.Duration(opts.KeyExpiry)
 
-	var uniqueValue [20]byte
-	_, _ = rand.Read(uniqueValue[:])
+	switch opts.Broker {
+	case "redis":
+		connOpts := RedisConnectOptions{
+			TLS:      opts.RedisTLS,
+			Username: opts.RedisUsername,
+			CAFile:   opts.RedisCA,
+			CertFile: opts.RedisCert,
+			KeyFile:  opts.RedisKey,
+		}
+		if opts.Mode == "stream" {
+			return newRedisStreamBroker(opts.RedisUrl, connOpts, opts.KeyPrefix, opts.Group, opts.Consumer, opts.StreamField, time.Second*time.Duration(opts.MinIdleTime))
+		}
+		return newRedisBroker(opts.RedisUrl, connOpts, opts.KeyPrefix, keyExpiry, buildRetryPolicy(opts))
+	case "kafka":
+		return newKafkaBroker(opts.BrokerUrl, opts.Topic, opts.Group)
+	case "nats":
+		return newNatsBroker(opts.BrokerUrl, opts.Topic, opts.Group)
+	case "sqs":
+		return newSqsBroker(opts.BrokerUrl, int32(opts.KeyExpiry))
+	default:
+		log.Printf("unknown broker %#v; expected redis, kafka, nats, or sqs\n", opts.Broker)
+		os.Exit(2)
+		return nil
+	}
+}
+
+// iterateBroker claims a single work item from broker and runs it to
+// completion. shouldContinue reports whether the caller should try another
+// item without treating this pass as done, mirroring the contention-skip
+// behaviour of the original Redis list implementation. claimed reports
+// whether an item was actually claimed and run, so exitCode holds a
+// meaningful result; when claimed is false (nothing was available to claim,
+// including because claimCtx was cancelled mid-Claim for a graceful
+// shutdown), exitCode's sentinel value must not be compared against
+// --exit-codes or reported as the process' exit code. claimCtx governs only
+// the Claim call, so that its cancellation (e.g. on SIGTERM) stops new items
+// being picked up without interrupting lease renewal or Ack/Nack of an item
+// already claimed, which always run against workCtx.
+func iterateBroker(claimCtx context.Context, workCtx context.Context, broker Broker, opts *Options) (shouldContinue bool, claimed bool, exitCode int, err error) {
+	shouldContinue = false
+	exitCode = -1
 
-	var setResponse string
-	setResponse, err = rds.SetArgs(ctx, lockKey, uniqueValue[:], redis.SetArgs{
-		Mode: "NX", // set if not exists
-		TTL:  keyExpiry,
-	}).Result()
-	// failed to take lock key:
-	if err == redis.Nil || setResponse != "OK" {
+	var workItem string
+	var lease Lease
+	workItem, lease, err = broker.Claim(claimCtx)
+	if err == ErrItemLocked {
+		// keep going, looking for an item which is not being processed:
+		lockContentionSkipsTotal.Inc()
 		err = nil
-		// keep going through list items, looking for one which is not being processed:
-		log.Printf("work item already processing: %#v\n", workItem)
 		shouldContinue = true
 		return
 	}
+	if err == ErrNoItemAvailable || err == context.Canceled {
+		// nothing to claim right now (empty queue, or a graceful shutdown
+		// cancelled claimCtx mid-Claim): there is no exitCode to report.
+		err = nil
+		return
+	}
 	if err != nil {
-		log.Printf("SET NX error: %v\n", err)
+		log.Printf("claim error: %v\n", err)
 		return
 	}
 
-	// we took the lock for this item so let's process it:
+	// we claimed the item so let's process it:
+	claimed = true
 	log.Printf("work item available: %#v\n", workItem)
+	itemsClaimedTotal.Inc()
+	itemsInFlight.Inc()
+	defer itemsInFlight.Dec()
+
+	lockKey, attempt := leaseDiagnostics(lease)
+	logItemEvent(opts, itemEvent{Event: "claimed", Item: workItem, LockKey: lockKey, Attempt: attempt})
+
+	data, err := decodeWorkItem(opts, workItem)
+	if err != nil {
+		log.Printf("work item decode error: %v\n", err)
+		if nackErr := broker.Nack(workCtx, lease, err); nackErr != nil {
+			log.Printf("nack error: %v\n", nackErr)
+		}
+		shouldContinue = true
+		err = nil
+		return
+	}
+	if valid, validateErr := validateWorkItem(data); validateErr != nil {
+		log.Printf("jsonschema validation error: %v\n", validateErr)
+		if nackErr := broker.Nack(workCtx, lease, validateErr); nackErr != nil {
+			log.Printf("nack error: %v\n", nackErr)
+		}
+		shouldContinue = true
+		return
+	} else if !valid {
+		log.Printf("work item %#v failed jsonschema validation; skipping\n", workItem)
+		if nackErr := broker.Nack(workCtx, lease, nil); nackErr != nil {
+			log.Printf("nack error: %v\n", nackErr)
+		}
+		shouldContinue = true
+		return
+	}
 
-	// run a keepalive thread in the background:
+	// run a keepalive thread in the background, renewing at half of the lock/visibility/idle-time expiry:
+	renewInterval := time.Second * time.Duration(opts.KeyExpiry) / 2
+	if opts.Broker == "redis" && opts.Mode == "stream" {
+		renewInterval = time.Second * time.Duration(opts.MinIdleTime) / 2
+	}
 	isComplete := make(chan struct{})
 	done := make(chan struct{})
-	go keepAlive(rds, lockKey, uniqueValue, keyExpiry, isComplete, done)
+	go keepAliveLease(workCtx, broker, lease, renewInterval, isComplete, done)
 
 	// start process:
-	cmd := prepareProcess(opts, workItem)
+	cmd, err := prepareProcess(opts, workItem, data)
+	if err != nil {
+		log.Printf("prepare process error: %v\n", err)
+		close(isComplete)
+		<-done
+		if nackErr := broker.Nack(workCtx, lease, &NackInfo{ExitCode: -1, Err: err}); nackErr != nil {
+			log.Printf("nack error: %v\n", nackErr)
+		}
+		return
+	}
+
+	// capture a bounded tail of stderr alongside the normal passthrough, so a
+	// poison item that ends up dead-lettered carries a clue as to why:
+	stderrTail := newTailBuffer(4096)
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, stderrTail)
+
 	log.Printf("start process: %#v\n", cmd.Args)
+	startedAt := time.Now()
 	if err = cmd.Start(); err != nil {
 		log.Printf("start process error: %v\n", err)
+		close(isComplete)
+		<-done
+		if nackErr := broker.Nack(workCtx, lease, &NackInfo{ExitCode: -1, Err: err}); nackErr != nil {
+			log.Printf("nack error: %v\n", nackErr)
+		}
 		return
 	}
 
 	// wait for process to exit:
 	err = cmd.Wait()
+	duration := time.Since(startedAt)
+	childDurationSeconds.Observe(duration.Seconds())
 
 	// mark completed:
 	close(isComplete)
@@ -202,10 +402,45 @@ func iterateList(ctx context.Context, rds *redis.Client, listKey string, lockKey
 	// wait for keepAlive thread to finish:
 	<-done
 
+	exitCodesTotal.WithLabelValues(strconv.Itoa(exitCode)).Inc()
+	lockKey, attempt = leaseDiagnostics(lease)
+	logItemEvent(opts, itemEvent{Event: "completed", Item: workItem, LockKey: lockKey, Attempt: attempt, DurationMs: duration.Milliseconds(), ExitCode: &exitCode})
+
+	// acknowledge or reject the item depending on whether the exit code is one we accept:
+	accepted := false
+	for _, okExitCode := range opts.ContinueOnExitCodes {
+		if okExitCode == exitCode {
+			accepted = true
+			break
+		}
+	}
+	if accepted {
+		if ackErr := broker.Ack(workCtx, lease); ackErr != nil {
+			log.Printf("ack error: %v\n", ackErr)
+		}
+	} else {
+		nackInfo := &NackInfo{ExitCode: exitCode, StderrTail: stderrTail.String(), Err: err}
+		if nackErr := broker.Nack(workCtx, lease, nackInfo); nackErr != nil {
+			log.Printf("nack error: %v\n", nackErr)
+		}
+	}
+
 	shouldContinue = false
 	return
 }
 
+// runOnce claims and processes a single item, for brokers that can't report
+// an outstanding item count up front.
+func runOnce(claimCtx context.Context, workCtx context.Context, broker Broker, opts *Options) (exitCode int, err error) {
+	var claimed bool
+	var code int
+	_, claimed, code, err = iterateBroker(claimCtx, workCtx, broker, opts)
+	if claimed {
+		exitCode = code
+	}
+	return
+}
+
 func setupLogging(opts *Options) (f *os.File) {
 	silence := opts.Quiet
 
@@ -228,6 +463,9 @@ func setupLogging(opts *Options) (f *os.File) {
 		}
 	}
 
+	// --log-format=json only changes how logItemEvent's own lines are
+	// written (see logging.go); every other log line keeps its usual prefix
+	// and timestamp regardless of --log-format.
 	fl := 0
 	if opts.NoLogTimestamps {
 		fl = 0
@@ -239,22 +477,6 @@ func setupLogging(opts *Options) (f *os.File) {
 	return
 }
 
-func connectRedis(redisUrl string) (rds *redis.Client) {
-	var err error
-
-	// parse REDIS_URL for connection info:
-	var options *redis.Options
-	options, err = redis.ParseURL(redisUrl)
-	if err != nil {
-		log.Printf("error parsing redis URL: %v\n", err)
-		os.Exit(2)
-	}
-
-	// connect to redis:
-	rds = redis.NewClient(options)
-	return
-}
-
 func validateOptions(opts *Options) {
 	var err error
 
@@ -265,33 +487,135 @@ func validateOptions(opts *Options) {
 		os.Exit(2)
 	}
 
-	if opts.RedisUrl == "" {
-		opts.RedisUrl = "redis://localhost:6379"
+	if opts.LogFormat != "text" && opts.LogFormat != "json" {
+		log.Printf("unknown --log-format %#v; expected text or json\n", opts.LogFormat)
+		os.Exit(2)
 	}
 
-	if opts.KeyPrefix == "" {
-		log.Println("warning: empty key-prefix; using global namespace for keys")
-	} else {
-		// make sure key prefix has a ':' suffix:
-		if !strings.HasSuffix(opts.KeyPrefix, ":") {
-			opts.KeyPrefix += ":"
+	if opts.Broker == "redis" || opts.Broker == "sqs" {
+		log.Printf("key expiry is %d seconds\n", opts.KeyExpiry)
+	}
+
+	if opts.Broker == "redis" {
+		if opts.RedisUrl == "" {
+			opts.RedisUrl = "redis://localhost:6379"
+		}
+
+		if opts.KeyPrefix == "" {
+			log.Println("warning: empty key-prefix; using global namespace for keys")
+		} else {
+			// make sure key prefix has a ':' suffix:
+			if !strings.HasSuffix(opts.KeyPrefix, ":") {
+				opts.KeyPrefix += ":"
+			}
+		}
+
+		log.Printf("key prefix = %#v\n", opts.KeyPrefix)
+
+		if opts.Mode == "stream" {
+			if opts.Group == "" {
+				opts.Group = "w8y"
+			}
+			if opts.Consumer == "" {
+				hostname, _ := os.Hostname()
+				opts.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+			}
+			log.Printf("stream group = %#v, consumer = %#v\n", opts.Group, opts.Consumer)
+		}
+
+		if opts.MaxAttempts > 0 {
+			// retryPolicy is only ever wired into newRedisBroker (see
+			// connectBroker); redis streams use consumer groups for
+			// redelivery instead, so --max-attempts there would be silently
+			// ignored rather than doing what its name implies.
+			if opts.Mode == "stream" {
+				log.Println("--max-attempts is not supported with --mode=stream")
+				os.Exit(2)
+			}
+			if _, _, err = parseBackoffPolicy(opts.Backoff); err != nil {
+				log.Printf("invalid --backoff: %v\n", err)
+				os.Exit(2)
+			}
+			if opts.DeadLetterKey == "" {
+				opts.DeadLetterKey = opts.KeyPrefix + "dead"
+			}
+			log.Printf("max attempts = %d, backoff = %#v, dead-letter key = %#v\n", opts.MaxAttempts, opts.Backoff, opts.DeadLetterKey)
+		}
+	} else if opts.Broker == "kafka" {
+		if opts.BrokerUrl == "" {
+			log.Println("--broker-url is required for --broker=kafka")
+			os.Exit(2)
+		}
+		if opts.Topic == "" {
+			log.Println("--topic is required for --broker=kafka")
+			os.Exit(2)
+		}
+		if opts.Group == "" {
+			log.Println("--group is required for --broker=kafka")
+			os.Exit(2)
+		}
+	} else if opts.Broker == "nats" {
+		if opts.BrokerUrl == "" {
+			log.Println("--broker-url is required for --broker=nats")
+			os.Exit(2)
+		}
+		if opts.Topic == "" {
+			log.Println("--topic is required for --broker=nats")
+			os.Exit(2)
+		}
+		if opts.Group == "" {
+			log.Println("--group is required for --broker=nats")
+			os.Exit(2)
+		}
+	} else if opts.Broker == "sqs" {
+		if opts.BrokerUrl == "" {
+			log.Println("--broker-url (queue URL) is required for --broker=sqs")
+			os.Exit(2)
 		}
 	}
 
-	log.Printf("key prefix = %#v\n", opts.KeyPrefix)
-	log.Printf("key expiry is %d seconds\n", opts.KeyExpiry)
+	if opts.JSONSchema != "" {
+		loadJSONSchema(opts.JSONSchema)
+	}
 
 	return
 }
 
-func prepareProcess(opts *Options, workItem string) *exec.Cmd {
+// buildRetryPolicy translates the --max-attempts/--backoff/--dead-letter-key
+// flags into the retryPolicy used by redisBroker. Options have already been
+// validated by validateOptions by the time this runs.
+func buildRetryPolicy(opts *Options) retryPolicy {
+	if opts.MaxAttempts <= 0 {
+		return retryPolicy{}
+	}
+
+	backoffBase, backoffMax, _ := parseBackoffPolicy(opts.Backoff)
+	return retryPolicy{
+		maxAttempts:   opts.MaxAttempts,
+		backoffBase:   backoffBase,
+		backoffMax:    backoffMax,
+		deadLetterKey: opts.DeadLetterKey,
+	}
+}
+
+// prepareProcess builds the child command for workItem. data is workItem
+// decoded per opts.ItemFormat (see decodeWorkItem) and is the root context
+// ("{{.}}") for any argument, --env, or --stdin-template templates.
+func prepareProcess(opts *Options, workItem string, data interface{}) (*exec.Cmd, error) {
 	// build arguments to the executable:
 	osArgs := opts.Args.Rest
 	args := make([]string, 0, len(osArgs))
 	for _, arg := range osArgs {
-		// replace {} token with the work item:
-		if arg == "{}" {
+		switch {
+		case arg == "{}":
+			// replace {} token with the raw work item:
 			arg = workItem
+		case strings.Contains(arg, "{{"):
+			rendered, err := renderTemplate("arg", arg, data)
+			if err != nil {
+				return nil, fmt.Errorf("error rendering argument template %#v: %w", arg, err)
+			}
+			arg = rendered
 		}
 		args = append(args, arg)
 	}
@@ -301,39 +625,50 @@ func prepareProcess(opts *Options, workItem string) *exec.Cmd {
 
 	// build environment variables:
 	osEnv := os.Environ()
-	var env []string
+	env := make([]string, 0, len(osEnv)+1+len(opts.Env))
 	if opts.EnvVar != "" {
 		// let the process know the work item via env vars:
-		env = make([]string, len(osEnv)+1)
-		env[0] = fmt.Sprintf("%s=%s", opts.EnvVar, workItem)
-		// copy existing env vars:
-		copy(env[1:], osEnv)
-	} else {
-		// copy existing env vars:
-		env = make([]string, len(osEnv))
-		copy(env, osEnv)
+		env = append(env, fmt.Sprintf("%s=%s", opts.EnvVar, workItem))
 	}
-
+	for _, spec := range opts.Env {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid --env %#v: expected NAME=template", spec)
+		}
+		rendered, err := renderTemplate("env:"+parts[0], parts[1], data)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering --env %#v: %w", parts[0], err)
+		}
+		env = append(env, fmt.Sprintf("%s=%s", parts[0], rendered))
+	}
+	env = append(env, osEnv...)
 	cmd.Env = env
 
 	// redirect standard file handles:
 	cmd.Stdin = os.Stdin
+	if opts.StdinTemplate != "" {
+		tmplText, err := loadTemplateSource(opts.StdinTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("error reading --stdin-template: %w", err)
+		}
+		rendered, err := renderTemplate("stdin", tmplText, data)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering --stdin-template: %w", err)
+		}
+		cmd.Stdin = strings.NewReader(rendered)
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	return cmd
+	return cmd, nil
 }
 
-func keepAlive(rds *redis.Client, lockKey string, uniqueValue [20]byte, expiry time.Duration, isComplete <-chan struct{}, done chan<- struct{}) {
-	var err error
-
-	ctx := context.Background()
-
-	// duration to renew is half of key expiry time:
-	duration := expiry / 2
-
-	// every duration, renew the key:
-	ticker := time.NewTicker(duration)
+// keepAliveLease periodically calls broker.Renew(lease) on a timer, local to
+// a single claimed item, until isComplete is closed. This replaces the old
+// Redis-specific lock-expiry renewal with one that works against any broker.
+func keepAliveLease(ctx context.Context, broker Broker, lease Lease, renewInterval time.Duration, isComplete <-chan struct{}, done chan<- struct{}) {
+	// every renewInterval, renew the lease:
+	ticker := time.NewTicker(renewInterval)
 
 loop:
 	for {
@@ -341,32 +676,13 @@ loop:
 		case <-isComplete:
 			break loop
 		case <-ticker.C:
-			// push out the expiry time:
-			var updated bool
-			if updated, err = rds.Expire(ctx, lockKey, expiry).Result(); err != nil {
-				log.Printf("EXPIRE %#v error: %v\n", lockKey, err)
-			} else if !updated {
-				log.Printf("EXPIRE %#v was not successful\n", lockKey)
+			if err := broker.Renew(ctx, lease); err != nil {
+				log.Printf("lease renew error: %v\n", err)
+				keepaliveRenewFailuresTotal.Inc()
 			}
 		}
 	}
 
-	//log.Printf("stopped keepAlive thread\n")
 	ticker.Stop()
-
-	// safe delete of lock key:
-	var ok int
-	if ok, err = rds.Eval(ctx, `
-if redis.call("get",KEYS[1]) == ARGV[1] then
-    return redis.call("del",KEYS[1])
-else
-    return 0
-end
-`, []string{lockKey}, uniqueValue[:]).Int(); err != nil {
-		log.Printf("DEL %#v error: %v\n", lockKey, err)
-	} else if ok == 0 {
-		log.Printf("DEL %#v was not successful\n", lockKey)
-	}
-
 	close(done)
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// These are the metrics --metrics-addr exposes at /metrics, for operators
+// running w8y under Kubernetes/systemd to alert on stuck locks and
+// throughput regressions.
+var (
+	itemsClaimedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "w8y_items_claimed_total",
+		Help: "Work items successfully claimed from the broker.",
+	})
+	lockContentionSkipsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "w8y_lock_contention_skips_total",
+		Help: "Claim attempts that found a work item already locked by another consumer.",
+	})
+	childDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "w8y_child_duration_seconds",
+		Help:    "Wall-clock duration of the child process spawned for each work item.",
+		Buckets: prometheus.DefBuckets,
+	})
+	exitCodesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "w8y_exit_codes_total",
+		Help: "Child process exit codes, by exit code.",
+	}, []string{"exit_code"})
+	keepaliveRenewFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "w8y_keepalive_renew_failures_total",
+		Help: "Broker.Renew calls made by the keepalive goroutine that returned an error.",
+	})
+	itemsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "w8y_items_in_flight",
+		Help: "Work items currently claimed and being processed.",
+	})
+)
+
+// startMetricsServer starts an HTTP server on addr exposing the metrics
+// above at /metrics, for --metrics-addr. It runs in the background for the
+// lifetime of the process; a failure to bind is treated as a fatal startup
+// error, consistent with how w8y handles other bad flags.
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.Printf("metrics listening on %#v\n", addr)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("metrics server error: %v\n", err)
+			os.Exit(2)
+		}
+	}()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsBroker implements Broker on top of a NATS JetStream pull consumer.
+// Ownership of a message is the JetStream ack-wait deadline: Renew extends it
+// with an in-progress indication, Ack acknowledges delivery, and Nack sends a
+// negative ack so JetStream redelivers the message immediately rather than
+// waiting out the ack-wait window.
+type natsBroker struct {
+	nc  *nats.Conn
+	sub *nats.Subscription
+}
+
+// natsLease carries the message whose ack state Renew/Ack/Nack manage.
+type natsLease struct {
+	msg *nats.Msg
+}
+
+func newNatsBroker(natsUrl string, subject string, durable string) *natsBroker {
+	nc, err := nats.Connect(natsUrl)
+	if err != nil {
+		log.Printf("error connecting to nats: %v\n", err)
+		os.Exit(2)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		log.Printf("error acquiring jetstream context: %v\n", err)
+		os.Exit(2)
+	}
+
+	sub, err := js.PullSubscribe(subject, durable)
+	if err != nil {
+		log.Printf("error creating pull subscription: %v\n", err)
+		os.Exit(2)
+	}
+
+	return &natsBroker{nc: nc, sub: sub}
+}
+
+func (b *natsBroker) Claim(ctx context.Context) (item string, lease Lease, err error) {
+	msgs, err := b.sub.Fetch(1, nats.Context(ctx))
+	if err != nil {
+		if err == nats.ErrTimeout || err == context.DeadlineExceeded {
+			err = ErrNoItemAvailable
+		}
+		return
+	}
+	if len(msgs) == 0 {
+		err = ErrNoItemAvailable
+		return
+	}
+
+	msg := msgs[0]
+	item = string(msg.Data)
+	lease = &natsLease{msg: msg}
+	return
+}
+
+func (b *natsBroker) Renew(ctx context.Context, lease Lease) error {
+	return lease.(*natsLease).msg.InProgress()
+}
+
+func (b *natsBroker) Ack(ctx context.Context, lease Lease) error {
+	return lease.(*natsLease).msg.Ack()
+}
+
+func (b *natsBroker) Nack(ctx context.Context, lease Lease, cause error) error {
+	return lease.(*natsLease).msg.Nak()
+}
+
+func (b *natsBroker) Close() error {
+	err := b.sub.Unsubscribe()
+	b.nc.Close()
+	return err
+}
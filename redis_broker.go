@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisBroker implements Broker on top of a Redis list used as a ring buffer:
+// items are popped from the head and atomically re-appended to the tail, with
+// a per-item SETNX lock key guarding against concurrent consumers, renewed on
+// a timer and deleted on completion. This is the original w8y backend. rds
+// may be a single-node, Sentinel-failover, or Cluster client; see
+// redis_connect.go.
+//
+// If retry.maxAttempts is set, Nack additionally tracks failed deliveries in
+// a Redis hash keyed by the work item, holds the item's lock key for a
+// backoff delay instead of releasing it immediately so Claim can't pick it
+// back up early, and finally moves the item to retry.deadLetterKey once
+// maxAttempts is exceeded. See handleFailure.
+type redisBroker struct {
+	rds               redis.UniversalClient
+	listKey           string
+	lockKeyPrefix     string
+	attemptsKeyPrefix string
+	keyExpiry         time.Duration
+	retry             retryPolicy
+}
+
+// redisLease identifies the lock key and the random value used to take it, so
+// that Renew/Ack/Nack only ever touch a lock this process itself holds.
+type redisLease struct {
+	item        string
+	lockKey     string
+	uniqueValue [20]byte
+	attempt     int64
+}
+
+// LockKey and Attempt implement LeaseDiagnostics, for --log-format=json.
+func (rl *redisLease) LockKey() string { return rl.lockKey }
+func (rl *redisLease) Attempt() int64  { return rl.attempt }
+
+// retryPolicy configures redisBroker's --max-attempts/--backoff/
+// --dead-letter-key retry tracking. The zero value disables it: Nack just
+// unlocks, as before.
+type retryPolicy struct {
+	maxAttempts   int
+	backoffBase   time.Duration
+	backoffMax    time.Duration
+	deadLetterKey string
+}
+
+// deadLetterEntry is the JSON payload LPUSHed to retryPolicy.deadLetterKey
+// once an item exceeds maxAttempts.
+type deadLetterEntry struct {
+	Item       string `json:"item"`
+	Attempts   int64  `json:"attempts"`
+	ExitCode   int    `json:"exit_code"`
+	Error      string `json:"error,omitempty"`
+	StderrTail string `json:"stderr_tail,omitempty"`
+	FailedAt   string `json:"failed_at"`
+}
+
+func newRedisBroker(redisUrl string, connOpts RedisConnectOptions, keyPrefix string, keyExpiry time.Duration, retry retryPolicy) *redisBroker {
+	return &redisBroker{
+		rds:               connectRedis(redisUrl, connOpts),
+		listKey:           keyPrefix + "list",
+		lockKeyPrefix:     keyPrefix + "lock:",
+		attemptsKeyPrefix: keyPrefix + "attempts:",
+		keyExpiry:         keyExpiry,
+		retry:             retry,
+	}
+}
+
+// parseBackoffPolicy parses a --backoff value of the form "kind:base:max",
+// e.g. "exponential:1s:60s". Only the "exponential" kind is currently
+// supported.
+func parseBackoffPolicy(s string) (base time.Duration, max time.Duration, err error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[0] != "exponential" {
+		return 0, 0, fmt.Errorf("unsupported --backoff %#v; expected exponential:<base>:<max>", s)
+	}
+	if base, err = time.ParseDuration(parts[1]); err != nil {
+		return 0, 0, fmt.Errorf("invalid --backoff base duration: %w", err)
+	}
+	if max, err = time.ParseDuration(parts[2]); err != nil {
+		return 0, 0, fmt.Errorf("invalid --backoff max duration: %w", err)
+	}
+	if base <= 0 || max <= 0 {
+		// backoffDelay's result feeds straight into the redis SET that holds
+		// the lock key's TTL, and go-redis treats a zero/negative expiration
+		// as "no TTL" rather than "expire immediately" — a non-positive base
+		// or max would silently turn a failed item's lock into a permanent
+		// one, so reject it here instead of at the SET call.
+		return 0, 0, fmt.Errorf("invalid --backoff %#v: base and max must be positive", s)
+	}
+	return base, max, nil
+}
+
+// backoffDelay computes the exponential backoff delay for the given attempt
+// number (1-indexed), doubling from base and capped at max.
+func backoffDelay(base, max time.Duration, attempt int64) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := base
+	for i := int64(1); i < attempt; i++ {
+		if delay >= max {
+			return max
+		}
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+func (b *redisBroker) Len(ctx context.Context) (int64, error) {
+	return b.rds.LLen(ctx, b.listKey).Result()
+}
+
+func (b *redisBroker) Claim(ctx context.Context) (item string, lease Lease, err error) {
+	// pop from left side of list and atomically append to right side of list:
+	var workItem string
+	if workItem, err = b.rds.LMove(ctx, b.listKey, b.listKey, "left", "right").Result(); err != nil {
+		log.Printf("LMOVE error: %v\n", err)
+		return
+	}
+
+	// attempt to take the lock:
+	lockKey := b.lockKeyPrefix + workItem
+
+	var uniqueValue [20]byte
+	_, _ = rand.Read(uniqueValue[:])
+
+	var setResponse string
+	setResponse, err = b.rds.SetArgs(ctx, lockKey, uniqueValue[:], redis.SetArgs{
+		Mode: "NX", // set if not exists
+		TTL:  b.keyExpiry,
+	}).Result()
+	// failed to take lock key:
+	if err == redis.Nil || setResponse != "OK" {
+		log.Printf("work item already processing: %#v\n", workItem)
+		err = ErrItemLocked
+		return
+	}
+	if err != nil {
+		log.Printf("SET NX error: %v\n", err)
+		return
+	}
+
+	var attempt int64
+	if b.retry.maxAttempts > 0 {
+		// best-effort: a missing or unreadable counter just means attempt 0:
+		attempt, _ = b.rds.HGet(ctx, b.attemptsKey(workItem), "attempts").Int64()
+	}
+
+	item = workItem
+	lease = &redisLease{item: workItem, lockKey: lockKey, uniqueValue: uniqueValue, attempt: attempt}
+	return
+}
+
+func (b *redisBroker) Renew(ctx context.Context, lease Lease) error {
+	rl := lease.(*redisLease)
+
+	updated, err := b.rds.Expire(ctx, rl.lockKey, b.keyExpiry).Result()
+	if err != nil {
+		return err
+	}
+	if !updated {
+		log.Printf("EXPIRE %#v was not successful\n", rl.lockKey)
+	}
+	return nil
+}
+
+// Ack releases the lock key. The item itself was already moved to the tail
+// of the list by Claim, so no further bookkeeping is needed on success.
+func (b *redisBroker) Ack(ctx context.Context, lease Lease) error {
+	return b.unlock(ctx, lease.(*redisLease))
+}
+
+// Nack releases the lock key so the item, which stays at the tail of the
+// list where Claim put it, can be tried again on a future pass. If retry
+// tracking is enabled (--max-attempts > 0), it instead defers to
+// handleFailure, which holds the lock key for a backoff delay and eventually
+// dead-letters the item instead of retrying it forever.
+func (b *redisBroker) Nack(ctx context.Context, lease Lease, cause error) error {
+	rl := lease.(*redisLease)
+
+	if b.retry.maxAttempts <= 0 {
+		return b.unlock(ctx, rl)
+	}
+	return b.handleFailure(ctx, rl, cause)
+}
+
+// handleFailure increments rl's attempt counter in a Redis hash keyed by the
+// work item. Below maxAttempts, it re-arms the existing lock key's expiry to
+// a backoff delay instead of deleting it, so Claim's SETNX can't pick the
+// item back up again until the delay elapses; this is the "EXPIRE-gated
+// lock" scheme rather than a separate delayed-visibility sorted set. At
+// maxAttempts, it moves the item to the dead-letter list instead.
+func (b *redisBroker) handleFailure(ctx context.Context, rl *redisLease, cause error) error {
+	attemptsKey := b.attemptsKey(rl.item)
+
+	attempts, err := b.rds.HIncrBy(ctx, attemptsKey, "attempts", 1).Result()
+	if err != nil {
+		return err
+	}
+
+	if attempts < int64(b.retry.maxAttempts) {
+		delay := backoffDelay(b.retry.backoffBase, b.retry.backoffMax, attempts)
+		log.Printf("work item %#v failed (attempt %d/%d); holding lock for %v before retry\n", rl.item, attempts, b.retry.maxAttempts, delay)
+		return b.rds.Set(ctx, rl.lockKey, rl.uniqueValue[:], delay).Err()
+	}
+
+	return b.deadLetter(ctx, rl, cause, attempts, attemptsKey)
+}
+
+// deadLetter atomically removes the item from the main list, pushes it along
+// with failure metadata onto retry.deadLetterKey, and clears its attempt
+// counter and lock key.
+func (b *redisBroker) deadLetter(ctx context.Context, rl *redisLease, cause error, attempts int64, attemptsKey string) error {
+	entry := deadLetterEntry{
+		Item:     rl.item,
+		Attempts: attempts,
+		ExitCode: -1,
+		FailedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if nackInfo, ok := cause.(*NackInfo); ok {
+		entry.ExitCode = nackInfo.ExitCode
+		entry.StderrTail = nackInfo.StderrTail
+	}
+	if cause != nil {
+		entry.Error = cause.Error()
+	}
+
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("work item %#v exceeded %d attempts; moving to dead-letter key %#v\n", rl.item, b.retry.maxAttempts, b.retry.deadLetterKey)
+
+	pipe := b.rds.TxPipeline()
+	pipe.LRem(ctx, b.listKey, 0, rl.item)
+	pipe.LPush(ctx, b.retry.deadLetterKey, payload)
+	pipe.Del(ctx, attemptsKey, rl.lockKey)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// attemptsKey is the Redis hash key tracking delivery attempts for item.
+func (b *redisBroker) attemptsKey(item string) string {
+	return b.attemptsKeyPrefix + item
+}
+
+func (b *redisBroker) unlock(ctx context.Context, rl *redisLease) error {
+	ok, err := b.rds.Eval(ctx, `
+if redis.call("get",KEYS[1]) == ARGV[1] then
+    return redis.call("del",KEYS[1])
+else
+    return 0
+end
+`, []string{rl.lockKey}, rl.uniqueValue[:]).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		log.Printf("DEL %#v was not successful\n", rl.lockKey)
+	}
+	return nil
+}
+
+func (b *redisBroker) Close() error {
+	return b.rds.Close()
+}
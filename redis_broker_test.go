@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	second := time.Second
+	tests := []struct {
+		name    string
+		base    time.Duration
+		max     time.Duration
+		attempt int64
+		want    time.Duration
+	}{
+		{"first attempt is base", second, 60 * second, 1, second},
+		{"zero attempt clamps up to first", second, 60 * second, 0, second},
+		{"negative attempt clamps up to first", second, 60 * second, -5, second},
+		{"doubles each attempt", second, 60 * second, 3, 4 * second},
+		{"caps at max once exceeded", second, 60 * second, 10, 60 * second},
+		{"caps at max exactly on the boundary", second, 8 * second, 4, 8 * second},
+		{"base already at or above max", 90 * second, 60 * second, 5, 60 * second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := backoffDelay(tt.base, tt.max, tt.attempt)
+			if got != tt.want {
+				t.Errorf("backoffDelay(%v, %v, %d) = %v, want %v", tt.base, tt.max, tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBackoffPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		wantBase time.Duration
+		wantMax  time.Duration
+		wantErr  bool
+	}{
+		{"valid exponential", "exponential:1s:60s", time.Second, 60 * time.Second, false},
+		{"valid with sub-second base", "exponential:500ms:30s", 500 * time.Millisecond, 30 * time.Second, false},
+		{"unsupported kind", "linear:1s:60s", 0, 0, true},
+		{"missing parts", "exponential:1s", 0, 0, true},
+		{"invalid base duration", "exponential:bogus:60s", 0, 0, true},
+		{"invalid max duration", "exponential:1s:bogus", 0, 0, true},
+		{"zero base rejected", "exponential:0s:60s", 0, 0, true},
+		{"negative base rejected", "exponential:-1s:60s", 0, 0, true},
+		{"zero max rejected", "exponential:1s:0s", 0, 0, true},
+		{"negative max rejected", "exponential:1s:-60s", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, max, err := parseBackoffPolicy(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseBackoffPolicy(%#v) = nil error, want error", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBackoffPolicy(%#v) unexpected error: %v", tt.spec, err)
+			}
+			if base != tt.wantBase || max != tt.wantMax {
+				t.Errorf("parseBackoffPolicy(%#v) = (%v, %v), want (%v, %v)", tt.spec, base, max, tt.wantBase, tt.wantMax)
+			}
+		})
+	}
+}
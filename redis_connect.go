@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisConnectOptions carries the TLS and ACL settings shared by every Redis
+// connection mode (single-node, Sentinel, Cluster).
+type RedisConnectOptions struct {
+	TLS      bool
+	Username string
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// connectRedis builds a redis.UniversalClient for redisUrl, which may be:
+//   - a standard "redis://" or "rediss://" URL, for a single node
+//   - "redis+sentinel://[user:pass@]host1:port1,host2:port2/mastername[/db]",
+//     for Sentinel-managed failover
+//   - "redis+cluster://[user:pass@]host1:port1,host2:port2", for Cluster
+//
+// connOpts.TLS, if set, enables TLS-in-transit for any of the above; the CA,
+// cert, and key fields are optional and only meaningful when TLS is used.
+func connectRedis(redisUrl string, connOpts RedisConnectOptions) redis.UniversalClient {
+	u, err := url.Parse(redisUrl)
+	if err != nil {
+		log.Printf("error parsing redis URL: %v\n", err)
+		os.Exit(2)
+	}
+
+	tlsConfig := buildRedisTLSConfig(connOpts)
+
+	switch u.Scheme {
+	case "redis+sentinel", "rediss+sentinel":
+		return connectRedisSentinel(u, connOpts, tlsConfig)
+	case "redis+cluster", "rediss+cluster":
+		return connectRedisCluster(u, connOpts, tlsConfig)
+	default:
+		var options *redis.Options
+		if options, err = redis.ParseURL(redisUrl); err != nil {
+			log.Printf("error parsing redis URL: %v\n", err)
+			os.Exit(2)
+		}
+		if connOpts.Username != "" {
+			options.Username = connOpts.Username
+		}
+		if tlsConfig != nil {
+			options.TLSConfig = tlsConfig
+		}
+		return redis.NewClient(options)
+	}
+}
+
+func connectRedisSentinel(u *url.URL, connOpts RedisConnectOptions, tlsConfig *tls.Config) redis.UniversalClient {
+	masterName, db := parseSentinelPath(u.Path)
+
+	failoverOpt := &redis.FailoverOptions{
+		MasterName:    masterName,
+		SentinelAddrs: strings.Split(u.Host, ","),
+		DB:            db,
+		TLSConfig:     tlsConfig,
+	}
+	if connOpts.Username != "" {
+		failoverOpt.Username = connOpts.Username
+	} else if u.User != nil {
+		failoverOpt.Username = u.User.Username()
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			failoverOpt.Password = password
+		}
+	}
+
+	return redis.NewFailoverClient(failoverOpt)
+}
+
+// parseSentinelPath splits the "/mastername[/db]" path of a redis+sentinel
+// URL into the master name and database index (defaulting db to 0).
+func parseSentinelPath(path string) (masterName string, db int) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) > 0 {
+		masterName = parts[0]
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		if n, err := strconv.Atoi(parts[1]); err == nil {
+			db = n
+		}
+	}
+	return
+}
+
+func connectRedisCluster(u *url.URL, connOpts RedisConnectOptions, tlsConfig *tls.Config) redis.UniversalClient {
+	clusterOpt := &redis.ClusterOptions{
+		Addrs:     strings.Split(u.Host, ","),
+		TLSConfig: tlsConfig,
+	}
+	if connOpts.Username != "" {
+		clusterOpt.Username = connOpts.Username
+	} else if u.User != nil {
+		clusterOpt.Username = u.User.Username()
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			clusterOpt.Password = password
+		}
+	}
+
+	return redis.NewClusterClient(clusterOpt)
+}
+
+// buildRedisTLSConfig returns nil if TLS was not requested, so callers can
+// leave redis.Options.TLSConfig unset and get the library's plain-TCP default.
+func buildRedisTLSConfig(connOpts RedisConnectOptions) *tls.Config {
+	if !connOpts.TLS && connOpts.CAFile == "" && connOpts.CertFile == "" {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if connOpts.CAFile != "" {
+		caCert, err := os.ReadFile(connOpts.CAFile)
+		if err != nil {
+			log.Printf("error reading --redis-ca file: %v\n", err)
+			os.Exit(2)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			log.Printf("error parsing --redis-ca file: no certificates found\n")
+			os.Exit(2)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if connOpts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(connOpts.CertFile, connOpts.KeyFile)
+		if err != nil {
+			log.Printf("error loading --redis-cert/--redis-key: %v\n", err)
+			os.Exit(2)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSentinelPath(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		wantMasterName string
+		wantDB         int
+	}{
+		{"master name only", "/mymaster", "mymaster", 0},
+		{"master name with db", "/mymaster/3", "mymaster", 3},
+		{"no leading slash", "mymaster", "mymaster", 0},
+		{"empty path", "", "", 0},
+		{"trailing slash with no db", "/mymaster/", "mymaster", 0},
+		{"non-numeric db ignored", "/mymaster/notanumber", "mymaster", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masterName, db := parseSentinelPath(tt.path)
+			if masterName != tt.wantMasterName || db != tt.wantDB {
+				t.Errorf("parseSentinelPath(%#v) = (%#v, %d), want (%#v, %d)", tt.path, masterName, db, tt.wantMasterName, tt.wantDB)
+			}
+		})
+	}
+}
+
+func TestBuildRedisTLSConfigNoTLSRequested(t *testing.T) {
+	got := buildRedisTLSConfig(RedisConnectOptions{})
+	if got != nil {
+		t.Fatalf("buildRedisTLSConfig(%#v) = %#v, want nil", RedisConnectOptions{}, got)
+	}
+}
+
+func TestBuildRedisTLSConfigTLSEnabledNoFiles(t *testing.T) {
+	got := buildRedisTLSConfig(RedisConnectOptions{TLS: true})
+	if got == nil {
+		t.Fatal("buildRedisTLSConfig with TLS: true = nil, want non-nil *tls.Config")
+	}
+	if got.RootCAs != nil || len(got.Certificates) != 0 {
+		t.Errorf("buildRedisTLSConfig with TLS: true and no files = %#v, want empty RootCAs/Certificates", got)
+	}
+}
+
+func TestBuildRedisTLSConfigCAAndCertFiles(t *testing.T) {
+	dir := t.TempDir()
+	caPath, certPath, keyPath := writeSelfSignedCertFiles(t, dir)
+
+	got := buildRedisTLSConfig(RedisConnectOptions{CAFile: caPath, CertFile: certPath, KeyFile: keyPath})
+	if got == nil {
+		t.Fatal("buildRedisTLSConfig with CAFile/CertFile/KeyFile = nil, want non-nil *tls.Config")
+	}
+	if got.RootCAs == nil {
+		t.Error("buildRedisTLSConfig did not populate RootCAs from --redis-ca")
+	}
+	if len(got.Certificates) != 1 {
+		t.Errorf("buildRedisTLSConfig loaded %d certificates, want 1", len(got.Certificates))
+	}
+}
+
+// writeSelfSignedCertFiles generates a throwaway self-signed cert/key pair
+// and writes the cert (also used as the CA) and key to dir, returning their
+// paths, so tests can exercise buildRedisTLSConfig's file-loading happy path
+// without shipping fixture files.
+func writeSelfSignedCertFiles(t *testing.T, dir string) (caPath, certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "w8y-test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating test certificate: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling test key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
+
+	caPath = filepath.Join(dir, "ca.pem")
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+
+	if err = os.WriteFile(caPath, certPEM, 0o600); err != nil {
+		t.Fatalf("writing test CA file: %v", err)
+	}
+	if err = os.WriteFile(certPath, certPEM, 0o600); err != nil {
+		t.Fatalf("writing test cert file: %v", err)
+	}
+	if err = os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		t.Fatalf("writing test key file: %v", err)
+	}
+	return caPath, certPath, keyPath
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisStreamBroker implements Broker on top of a Redis Stream consumer
+// group (XREADGROUP), used when --mode=stream. Ownership of a claimed entry
+// is tracked by Redis' own pending-entries list (PEL) rather than a separate
+// lock key: Renew re-XCLAIMs the entry for this consumer to reset its idle
+// time, Ack runs XACK+XDEL, and Nack simply leaves the entry pending so a
+// future Claim can recover it. Before reading new entries, Claim also checks
+// for entries abandoned by dead consumers (idle longer than minIdleTime) via
+// XPENDING+XCLAIM, which is the stream equivalent of the list broker's
+// keepalive/expire lock dance.
+type redisStreamBroker struct {
+	rds         redis.UniversalClient
+	streamKey   string
+	group       string
+	consumer    string
+	field       string
+	minIdleTime time.Duration
+	readBlock   time.Duration
+}
+
+// streamLease identifies the stream entry ID that Renew/Ack/Nack act on.
+type streamLease struct {
+	id string
+}
+
+func newRedisStreamBroker(redisUrl string, connOpts RedisConnectOptions, keyPrefix string, group string, consumer string, field string, minIdleTime time.Duration) *redisStreamBroker {
+	rds := connectRedis(redisUrl, connOpts)
+	streamKey := keyPrefix + "stream"
+
+	ctx := context.Background()
+	if err := rds.XGroupCreateMkStream(ctx, streamKey, group, "0").Err(); err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		log.Printf("error creating consumer group %#v on stream %#v: %v\n", group, streamKey, err)
+		os.Exit(2)
+	}
+
+	return &redisStreamBroker{
+		rds:         rds,
+		streamKey:   streamKey,
+		group:       group,
+		consumer:    consumer,
+		field:       field,
+		minIdleTime: minIdleTime,
+		readBlock:   5 * time.Second,
+	}
+}
+
+func (b *redisStreamBroker) Len(ctx context.Context) (int64, error) {
+	return b.rds.XLen(ctx, b.streamKey).Result()
+}
+
+func (b *redisStreamBroker) Claim(ctx context.Context) (item string, lease Lease, err error) {
+	// first, try to recover an entry abandoned by a dead consumer:
+	var msg *redis.XMessage
+	if msg, err = b.reclaimAbandoned(ctx); err != nil {
+		return
+	}
+
+	if msg == nil {
+		// nothing to recover; read a new entry for this consumer:
+		var streams []redis.XStream
+		streams, err = b.rds.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    b.group,
+			Consumer: b.consumer,
+			Streams:  []string{b.streamKey, ">"},
+			Count:    1,
+			Block:    b.readBlock,
+		}).Result()
+		if err == redis.Nil {
+			err = ErrNoItemAvailable
+			return
+		}
+		if err != nil {
+			return
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			err = ErrNoItemAvailable
+			return
+		}
+		msg = &streams[0].Messages[0]
+	}
+
+	value, ok := msg.Values[b.field]
+	if !ok {
+		err = fmt.Errorf("stream entry %s missing field %#v", msg.ID, b.field)
+		return
+	}
+
+	item = fmt.Sprint(value)
+	lease = &streamLease{id: msg.ID}
+	return
+}
+
+// reclaimAbandoned looks for one pending entry idle longer than minIdleTime
+// and, if found, claims it for this consumer. Returns a nil message (and no
+// error) if there is nothing to reclaim.
+func (b *redisStreamBroker) reclaimAbandoned(ctx context.Context) (*redis.XMessage, error) {
+	pending, err := b.rds.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: b.streamKey,
+		Group:  b.group,
+		Idle:   b.minIdleTime,
+		Start:  "-",
+		End:    "+",
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	claimed, err := b.rds.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   b.streamKey,
+		Group:    b.group,
+		Consumer: b.consumer,
+		MinIdle:  b.minIdleTime,
+		Messages: []string{pending[0].ID},
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(claimed) == 0 {
+		// entry was claimed by someone else between XPENDING and XCLAIM:
+		return nil, nil
+	}
+
+	log.Printf("reclaimed abandoned stream entry %#v from consumer %#v\n", claimed[0].ID, pending[0].Consumer)
+	return &claimed[0], nil
+}
+
+// Renew re-claims lease's own entry for this consumer, which resets its idle
+// time in the pending-entries list and so prevents another consumer's
+// XPENDING+XCLAIM recovery pass from mistaking it for abandoned work.
+func (b *redisStreamBroker) Renew(ctx context.Context, lease Lease) error {
+	sl := lease.(*streamLease)
+	_, err := b.rds.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   b.streamKey,
+		Group:    b.group,
+		Consumer: b.consumer,
+		MinIdle:  0,
+		Messages: []string{sl.id},
+	}).Result()
+	return err
+}
+
+func (b *redisStreamBroker) Ack(ctx context.Context, lease Lease) error {
+	sl := lease.(*streamLease)
+	if err := b.rds.XAck(ctx, b.streamKey, b.group, sl.id).Err(); err != nil {
+		return err
+	}
+	return b.rds.XDel(ctx, b.streamKey, sl.id).Err()
+}
+
+// Nack leaves the entry pending; it will be picked up again by a future
+// reclaimAbandoned pass once it has been idle for minIdleTime.
+func (b *redisStreamBroker) Nack(ctx context.Context, lease Lease, cause error) error {
+	return nil
+}
+
+func (b *redisStreamBroker) Close() error {
+	return b.rds.Close()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// sqsBroker implements Broker on top of an AWS SQS queue. SQS already
+// guarantees at-most-one-visible-consumer per message via its visibility
+// timeout, so there's no separate lock key: Renew extends the visibility
+// timeout, Ack deletes the message, and Nack resets the visibility timeout to
+// zero so the message becomes immediately eligible for redelivery.
+type sqsBroker struct {
+	client            *sqs.Client
+	queueUrl          string
+	visibilityTimeout int32
+}
+
+// sqsLease carries the receipt handle that Renew/Ack/Nack act on.
+type sqsLease struct {
+	receiptHandle string
+}
+
+func newSqsBroker(queueUrl string, visibilityTimeout int32) *sqsBroker {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Printf("error loading AWS config: %v\n", err)
+		os.Exit(2)
+	}
+
+	return &sqsBroker{
+		client:            sqs.NewFromConfig(cfg),
+		queueUrl:          queueUrl,
+		visibilityTimeout: visibilityTimeout,
+	}
+}
+
+func (b *sqsBroker) Claim(ctx context.Context) (item string, lease Lease, err error) {
+	var out *sqs.ReceiveMessageOutput
+	out, err = b.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            &b.queueUrl,
+		MaxNumberOfMessages: 1,
+		VisibilityTimeout:   b.visibilityTimeout,
+		WaitTimeSeconds:     20, // long poll
+	})
+	if err != nil {
+		// the AWS SDK wraps a cancelled ctx in a *smithy.OperationError, so a
+		// plain == comparison against context.Canceled/DeadlineExceeded (as
+		// iterateBroker does) would miss it; unwrap it here instead so a
+		// claimCtx cancellation (e.g. on SIGTERM) is treated the same as no
+		// item being available, not a hard claim error.
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			err = ErrNoItemAvailable
+		}
+		return
+	}
+	if len(out.Messages) == 0 {
+		err = ErrNoItemAvailable
+		return
+	}
+
+	msg := out.Messages[0]
+	item = aws.ToString(msg.Body)
+	lease = &sqsLease{receiptHandle: aws.ToString(msg.ReceiptHandle)}
+	return
+}
+
+func (b *sqsBroker) Renew(ctx context.Context, lease Lease) error {
+	sl := lease.(*sqsLease)
+	_, err := b.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          &b.queueUrl,
+		ReceiptHandle:     &sl.receiptHandle,
+		VisibilityTimeout: b.visibilityTimeout,
+	})
+	return err
+}
+
+func (b *sqsBroker) Ack(ctx context.Context, lease Lease) error {
+	sl := lease.(*sqsLease)
+	_, err := b.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      &b.queueUrl,
+		ReceiptHandle: &sl.receiptHandle,
+	})
+	return err
+}
+
+// Nack resets the visibility timeout to zero so the message becomes eligible
+// for redelivery right away instead of waiting out the normal timeout.
+func (b *sqsBroker) Nack(ctx context.Context, lease Lease, cause error) error {
+	sl := lease.(*sqsLease)
+	_, err := b.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          &b.queueUrl,
+		ReceiptHandle:     &sl.receiptHandle,
+		VisibilityTimeout: 0,
+	})
+	return err
+}
+
+func (b *sqsBroker) Close() error {
+	return nil
+}